@@ -0,0 +1,96 @@
+// Package announcement sends release announcements to webhooks such as chat channels or an email
+// relay.
+package announcement
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Download struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	Size     int64  `json:"size"`
+}
+
+// Announcement of a release.
+type Announcement struct {
+	Version      string     `json:"version"`
+	Title        string     `json:"title"`
+	ReleaseNotes string     `json:"releaseNotes"`
+	Highlights   []string   `json:"highlights"`
+	Downloads    []Download `json:"downloads"`
+	Text         string     `json:"text"`
+}
+
+// Timeout of each webhook request.
+const TIMEOUT = 30 * time.Second
+
+// Returns the URL and the request body for a webhook. Webhooks are given as `[format:]url`, where
+// the format is `text` (Slack and Mattermost), `content` (Discord) or `json` (the whole
+// announcement, for an email relay). The default is `json`.
+func Request(a Announcement, webhook string) (string, []byte, error) {
+	format, u := "json", webhook
+	if i := strings.Index(webhook, ":"); i >= 0 {
+		switch webhook[:i] {
+		case "text", "content", "json":
+			format, u = webhook[:i], webhook[i+1:]
+		}
+	}
+	var body interface{} = a
+	switch format {
+	case "text":
+		body = map[string]string{"text": a.Text}
+	case "content":
+		body = map[string]string{"content": a.Text}
+	}
+	data, err := json.Marshal(body)
+	return u, data, err
+}
+
+// Returns the webhooks that are not in `sent`.
+func Pending(webhooks, sent []string) []string {
+	isSent := make(map[string]bool)
+	for _, webhook := range sent {
+		isSent[webhook] = true
+	}
+	pending := []string{}
+	for _, webhook := range webhooks {
+		if !isSent[webhook] {
+			pending = append(pending, webhook)
+		}
+	}
+	return pending
+}
+
+// Posts the announcement to the webhooks that are not in `sent`. Returns `sent` with the webhooks
+// that received the announcement added, and the errors of the webhooks that failed. Calling Send
+// again with the returned list only retries the failed webhooks.
+func Send(a Announcement, webhooks, sent []string) ([]string, map[string]error) {
+	client := &http.Client{Timeout: TIMEOUT}
+	failed := make(map[string]error)
+	sent = append([]string{}, sent...)
+	for _, webhook := range Pending(webhooks, sent) {
+		u, body, err := Request(a, webhook)
+		if err == nil {
+			var resp *http.Response
+			resp, err = client.Post(u, "application/json", bytes.NewReader(body))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					err = errors.New(resp.Status)
+				}
+			}
+		}
+		if err != nil {
+			failed[webhook] = err
+		} else {
+			sent = append(sent, webhook)
+		}
+	}
+	return sent, failed
+}
@@ -0,0 +1,127 @@
+package announcement
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var testAnnouncement = Announcement{
+	Version:      "2022.1.1",
+	Title:        "The Machinery hotfix 2022.1.1 is out!",
+	ReleaseNotes: "https://ourmachinery.com/post/release-2022-1#hotfix-1",
+	Highlights:   []string{"Fixed a crash"},
+	Downloads:    []Download{{Platform: "Windows", URL: "https://ourmachinery.com/releases/2022.1/the-machinery-2022.1.1-windows.zip", Size: 1024}},
+	Text:         "The Machinery hotfix 2022.1.1 is out!\n",
+}
+
+// A stand-in for the webhooks that records the bodies posted to each path. Paths in `failures`
+// fail that many times before they succeed.
+type webhookServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	bodies   map[string][]string
+	failures map[string]int
+}
+
+func newWebhookServer(t *testing.T, failures map[string]int) *webhookServer {
+	s := &webhookServer{bodies: make(map[string][]string), failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %s with content type %q, want a JSON post", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.bodies[r.URL.Path] = append(s.bodies[r.URL.Path], string(body))
+		if s.failures[r.URL.Path] > 0 {
+			s.failures[r.URL.Path]--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSendPayloads(t *testing.T) {
+	s := newWebhookServer(t, nil)
+	text, _ := json.Marshal(map[string]string{"text": testAnnouncement.Text})
+	content, _ := json.Marshal(map[string]string{"content": testAnnouncement.Text})
+	whole, _ := json.Marshal(testAnnouncement)
+	tests := []struct {
+		webhook string
+		path    string
+		body    string
+	}{
+		{"text:" + s.URL + "/slack", "/slack", string(text)},
+		{"content:" + s.URL + "/discord", "/discord", string(content)},
+		{"json:" + s.URL + "/relay", "/relay", string(whole)},
+		{s.URL + "/default", "/default", string(whole)},
+	}
+	webhooks := []string{}
+	for _, test := range tests {
+		webhooks = append(webhooks, test.webhook)
+	}
+
+	sent, failed := Send(testAnnouncement, webhooks, nil)
+	if len(failed) > 0 {
+		t.Fatalf("Send() failed: %v", failed)
+	}
+	if !reflect.DeepEqual(sent, webhooks) {
+		t.Errorf("Send() sent to %q, want %q", sent, webhooks)
+	}
+	for _, test := range tests {
+		if got := s.bodies[test.path]; len(got) != 1 || got[0] != test.body {
+			t.Errorf("%s got %q, want %s", test.webhook, got, test.body)
+		}
+	}
+}
+
+func TestSendResumesAfterFailure(t *testing.T) {
+	s := newWebhookServer(t, map[string]int{"/flaky": 1})
+	webhooks := []string{"text:" + s.URL + "/ok", "text:" + s.URL + "/flaky", s.URL + "/other"}
+
+	sent, failed := Send(testAnnouncement, webhooks, nil)
+	if len(failed) != 1 || failed[webhooks[1]] == nil {
+		t.Errorf("Send() failed for %v, want only %s", failed, webhooks[1])
+	}
+	if want := []string{webhooks[0], webhooks[2]}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("Send() sent to %q, want %q", sent, want)
+	}
+	if pending := Pending(webhooks, sent); !reflect.DeepEqual(pending, []string{webhooks[1]}) {
+		t.Errorf("Pending() = %q, want the failed webhook", pending)
+	}
+
+	sent, failed = Send(testAnnouncement, webhooks, sent)
+	if len(failed) > 0 {
+		t.Errorf("resending failed: %v", failed)
+	}
+	if want := []string{webhooks[0], webhooks[2], webhooks[1]}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("resending sent to %q, want %q", sent, want)
+	}
+	for path, want := range map[string]int{"/ok": 1, "/flaky": 2, "/other": 1} {
+		if got := len(s.bodies[path]); got != want {
+			t.Errorf("%s got %d posts, want %d", path, got, want)
+		}
+	}
+	if pending := Pending(webhooks, sent); len(pending) != 0 {
+		t.Errorf("Pending() = %q after all webhooks got the announcement", pending)
+	}
+}
+
+func TestSendReportsUnreachableWebhooks(t *testing.T) {
+	s := newWebhookServer(t, nil)
+	url := s.URL
+	s.Close()
+	sent, failed := Send(testAnnouncement, []string{"text:" + url + "/gone"}, []string{"text:" + url + "/earlier"})
+	if len(failed) != 1 {
+		t.Errorf("Send() to a closed server failed for %v", failed)
+	}
+	if !reflect.DeepEqual(sent, []string{"text:" + url + "/earlier"}) {
+		t.Errorf("Send() = %q, want only the webhook sent before", sent)
+	}
+}
@@ -0,0 +1,411 @@
+// Package ftpclient is the FTP client shared by release.go and upload-lib.go. It wraps
+// github.com/jlaffaye/ftp with connection profiles, connection reuse, recursive directory
+// creation and errors that tell which operation failed on which path.
+package ftpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+)
+
+// The profile of the ourmachinery.com website.
+const DefaultProfile = "ftp://ourmachinery@92.205.9.87:21"
+
+// Connections that have been idle for longer than this are checked with a NOOP before they are
+// reused.
+const IDLE_CHECK = 30 * time.Second
+
+// Where and how to connect.
+type Profile struct {
+	// Address of the server, as host:port.
+	Host     string
+	User     string
+	Password string
+
+	// Use explicit FTPS: the connection is upgraded with AUTH TLS after connecting.
+	TLS bool
+
+	// Use PASV instead of EPSV for passive mode, for servers and firewalls that don't support
+	// EPSV.
+	DisableEPSV bool
+
+	// Timeout for connecting and for each command, 0 for the default.
+	Timeout time.Duration
+}
+
+// Parses a profile of the form `ftp://user@host:port` or `ftps://user@host:port` (explicit FTPS).
+// The `epsv=false` query parameter disables EPSV and `timeout=<duration>` sets the timeout. The
+// password is never part of the profile.
+func ParseProfile(s string) (Profile, error) {
+	var p Profile
+	u, err := url.Parse(s)
+	if err != nil {
+		return p, err
+	}
+	switch u.Scheme {
+	case "ftp":
+	case "ftps":
+		p.TLS = true
+	default:
+		return p, errors.New("unknown FTP profile scheme: " + s)
+	}
+	p.Host = u.Host
+	if u.Port() == "" {
+		p.Host = net.JoinHostPort(u.Hostname(), "21")
+	}
+	if u.User != nil {
+		p.User = u.User.Username()
+	}
+	q := u.Query()
+	if v := q.Get("epsv"); v != "" {
+		epsv, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, err
+		}
+		p.DisableEPSV = !epsv
+	}
+	if v := q.Get("timeout"); v != "" {
+		p.Timeout, err = time.ParseDuration(v)
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+func (p Profile) String() string {
+	scheme := "ftp"
+	if p.TLS {
+		scheme = "ftps"
+	}
+	return scheme + "://" + p.User + "@" + p.Host
+}
+
+// Returned for files and directories that don't exist, test for it with errors.Is().
+var ErrNotFound = errors.New("file not found")
+
+// An error from an FTP operation.
+type Error struct {
+	Op   string
+	Path string
+	Err  error
+
+	// Set when the path was confirmed to be missing, see checkNotFound().
+	notFound bool
+}
+
+func (e *Error) Error() string {
+	return "ftp " + e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Only errors for paths that were confirmed to be missing are reported as ErrNotFound. The 550
+// reply alone doesn't tell, since servers also use it when permission is denied.
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.notFound
+}
+
+// A client that connects when it is first used and reuses the connection until it is closed.
+// Relative paths are relative to the directory the user is in after logging in.
+type Client struct {
+	profile Profile
+	conn    *ftp.ServerConn
+	home    string
+	lastUse time.Time
+
+	// Directories known to exist on the server.
+	dirs map[string]bool
+}
+
+func New(p Profile) *Client {
+	return &Client{profile: p}
+}
+
+func (c *Client) Profile() Profile {
+	return c.profile
+}
+
+func (c *Client) connect() (*ftp.ServerConn, error) {
+	if c.conn != nil && time.Since(c.lastUse) > IDLE_CHECK && c.conn.NoOp() != nil {
+		c.conn.Quit()
+		c.conn = nil
+	}
+	if c.conn == nil {
+		options := []ftp.DialOption{ftp.DialWithDisabledEPSV(c.profile.DisableEPSV)}
+		if c.profile.Timeout > 0 {
+			options = append(options, ftp.DialWithTimeout(c.profile.Timeout))
+		}
+		if c.profile.TLS {
+			host, _, _ := net.SplitHostPort(c.profile.Host)
+			options = append(options, ftp.DialWithExplicitTLS(&tls.Config{ServerName: host}))
+		}
+		conn, err := ftp.Dial(c.profile.Host, options...)
+		if err != nil {
+			return nil, &Error{Op: "dial", Path: c.profile.Host, Err: err}
+		}
+		err = conn.Login(c.profile.User, c.profile.Password)
+		if err != nil {
+			conn.Quit()
+			return nil, &Error{Op: "login", Path: c.profile.String(), Err: err}
+		}
+		c.home, err = conn.CurrentDir()
+		if err != nil {
+			conn.Quit()
+			return nil, &Error{Op: "pwd", Path: c.profile.String(), Err: err}
+		}
+		c.conn = conn
+		c.dirs = make(map[string]bool)
+	}
+	c.lastUse = time.Now()
+	return c.conn, nil
+}
+
+// Runs the operation on the connection. If it fails with anything but an FTP reply, the
+// connection is dropped so that the next operation reconnects.
+func (c *Client) do(op, file string, f func(conn *ftp.ServerConn, p string) error) error {
+	conn, err := c.connect()
+	if err != nil {
+		return err
+	}
+	err = f(conn, c.path(file))
+	if err == nil {
+		return nil
+	}
+	var tp *textproto.Error
+	if !errors.As(err, &tp) {
+		conn.Quit()
+		c.conn = nil
+	}
+	return &Error{Op: op, Path: file, Err: err}
+}
+
+// Returns true if the reply is 550, which servers use both for missing files and for denied
+// permissions.
+func isUnavailable(err error) bool {
+	var tp *textproto.Error
+	return errors.As(err, &tp) && tp.Code == ftp.StatusFileUnavailable
+}
+
+// Returns true if listing the parent directory shows that the path doesn't exist. A missing
+// parent directory is checked the same way.
+func (c *Client) isMissing(file string) bool {
+	dir, name := path.Dir(file), path.Base(file)
+	var entries []*ftp.Entry
+	err := c.do("list", dir, func(conn *ftp.ServerConn, p string) error {
+		var err error
+		entries, err = conn.List(p)
+		return err
+	})
+	if err != nil {
+		return isUnavailable(err) && dir != "." && dir != "/" && c.isMissing(dir)
+	}
+	for _, e := range entries {
+		if e.Name == name {
+			return false
+		}
+	}
+	return true
+}
+
+// Makes a 550 error for the path match ErrNotFound if the path is confirmed to be missing.
+func (c *Client) checkNotFound(err error, file string) error {
+	var e *Error
+	if errors.As(err, &e) && isUnavailable(err) && c.isMissing(file) {
+		e.notFound = true
+	}
+	return err
+}
+
+// Returns the path of the directory and of each of its parents, outermost first.
+func dirPrefixes(dir string) []string {
+	prefixes := []string{}
+	cur := ""
+	if strings.HasPrefix(dir, "/") {
+		cur = "/"
+	}
+	for _, part := range strings.Split(dir, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		cur = path.Join(cur, part)
+		prefixes = append(prefixes, cur)
+	}
+	return prefixes
+}
+
+func (c *Client) path(file string) string {
+	if strings.HasPrefix(file, "/") {
+		return file
+	}
+	return path.Join(c.home, file)
+}
+
+// Creates the directory and its parents if they don't exist.
+func (c *Client) MakeDirAll(dir string) error {
+	for _, cur := range dirPrefixes(dir) {
+		if c.dirs[cur] {
+			continue
+		}
+		err := c.do("mkdir", cur, func(conn *ftp.ServerConn, p string) error {
+			if conn.ChangeDir(p) == nil {
+				return nil
+			}
+			return conn.MakeDir(p)
+		})
+		if err != nil {
+			return err
+		}
+		c.dirs[cur] = true
+	}
+	return nil
+}
+
+// Stores the contents of `r` in the file, creating its directory if needed.
+func (c *Client) Stor(file string, r io.Reader) error {
+	err := c.MakeDirAll(path.Dir(file))
+	if err != nil {
+		return err
+	}
+	return c.do("stor", file, func(conn *ftp.ServerConn, p string) error {
+		return conn.Stor(p, r)
+	})
+}
+
+// Uploads the local file to the directory, creating the directory if needed.
+func (c *Client) UploadFile(srcFile, dir string) error {
+	f, err := os.Open(srcFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Stor(path.Join(dir, filepath.Base(srcFile)), f)
+}
+
+// Opens the file for reading. The reader must be closed before the client is used again.
+func (c *Client) Retr(file string) (io.ReadCloser, error) {
+	var r io.ReadCloser
+	err := c.do("retr", file, func(conn *ftp.ServerConn, p string) error {
+		resp, err := conn.Retr(p)
+		r = resp
+		return err
+	})
+	return r, c.checkNotFound(err, file)
+}
+
+// Returns the contents of the file.
+func (c *Client) ReadFile(file string) ([]byte, error) {
+	r, err := c.Retr(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, &Error{Op: "retr", Path: file, Err: err}
+	}
+	return data, nil
+}
+
+func (c *Client) FileSize(file string) (int64, error) {
+	var size int64
+	err := c.do("size", file, func(conn *ftp.ServerConn, p string) error {
+		var err error
+		size, err = conn.FileSize(p)
+		return err
+	})
+	return size, c.checkNotFound(err, file)
+}
+
+func (c *Client) Delete(file string) error {
+	err := c.do("delete", file, func(conn *ftp.ServerConn, p string) error {
+		return conn.Delete(p)
+	})
+	return c.checkNotFound(err, file)
+}
+
+func (c *Client) rename(from, to string) error {
+	return c.do("rename", from, func(conn *ftp.ServerConn, p string) error {
+		return conn.Rename(p, c.path(to))
+	})
+}
+
+// Renames the file, replacing any existing file at `to`. Some servers refuse to rename over an
+// existing file, in which case `to` is deleted and the rename is retried.
+func (c *Client) Rename(from, to string) error {
+	err := c.rename(from, to)
+	var tp *textproto.Error
+	if err == nil || !errors.As(err, &tp) {
+		return err
+	}
+	if _, sizeErr := c.FileSize(to); sizeErr != nil {
+		return err
+	}
+	err = c.Delete(to)
+	if err != nil {
+		return err
+	}
+	return c.rename(from, to)
+}
+
+// Returns the size of every file under `dir`, keyed by the path relative to `dir`.
+func (c *Client) List(dir string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	var list func(rel string) error
+	list = func(rel string) error {
+		var entries []*ftp.Entry
+		err := c.do("list", path.Join(dir, rel), func(conn *ftp.ServerConn, p string) error {
+			var err error
+			entries, err = conn.List(p)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Name == "." || e.Name == ".." {
+				continue
+			}
+			file := path.Join(rel, e.Name)
+			if e.Type == ftp.EntryTypeFolder {
+				err = list(file)
+				if err != nil {
+					return err
+				}
+			} else if e.Type == ftp.EntryTypeFile {
+				files[file] = int64(e.Size)
+			}
+		}
+		return nil
+	}
+	return files, c.checkNotFound(list(""), dir)
+}
+
+// Closes the connection. The client reconnects if it is used again.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Quit()
+	c.conn = nil
+	if err != nil {
+		return fmt.Errorf("ftp quit: %w", err)
+	}
+	return nil
+}
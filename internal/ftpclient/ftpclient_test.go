@@ -0,0 +1,253 @@
+package ftpclient
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseProfile(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Profile
+		wantErr bool
+	}{
+		{in: "ftp://user@example.com:2121", want: Profile{Host: "example.com:2121", User: "user"}},
+		{in: "ftp://user@example.com", want: Profile{Host: "example.com:21", User: "user"}},
+		{in: "ftps://user@example.com", want: Profile{Host: "example.com:21", User: "user", TLS: true}},
+		{in: "ftp://example.com", want: Profile{Host: "example.com:21"}},
+		{in: "ftp://user@[::1]", want: Profile{Host: "[::1]:21", User: "user"}},
+		{in: "ftp://user@example.com?epsv=false", want: Profile{Host: "example.com:21", User: "user", DisableEPSV: true}},
+		{in: "ftp://user@example.com?epsv=true", want: Profile{Host: "example.com:21", User: "user"}},
+		{in: "ftp://user@example.com?timeout=90s", want: Profile{Host: "example.com:21", User: "user", Timeout: 90 * time.Second}},
+		{in: "ftps://user@example.com:990?epsv=0&timeout=1m", want: Profile{Host: "example.com:990", User: "user", TLS: true, DisableEPSV: true, Timeout: time.Minute}},
+		{in: "sftp://user@example.com", wantErr: true},
+		{in: "example.com", wantErr: true},
+		{in: "ftp://user@example.com?epsv=maybe", wantErr: true},
+		{in: "ftp://user@example.com?timeout=soon", wantErr: true},
+		{in: "ftp://user@example.com:%zz", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := ParseProfile(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseProfile(%q) = %+v, want an error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseProfile(%q) failed: %v", test.in, err)
+		} else if got != test.want {
+			t.Errorf("ParseProfile(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestProfileString(t *testing.T) {
+	for _, in := range []string{"ftp://user@example.com:21", "ftps://user@example.com:990"} {
+		p, err := ParseProfile(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != in {
+			t.Errorf("ParseProfile(%q).String() = %q", in, p.String())
+		}
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	unavailable := &textproto.Error{Code: 550, Msg: "No such file or permission denied"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"confirmed missing", &Error{Op: "size", Path: "a", Err: unavailable, notFound: true}, true},
+		{"550 alone", &Error{Op: "size", Path: "a", Err: unavailable}, false},
+		{"other reply", &Error{Op: "stor", Path: "a", Err: &textproto.Error{Code: 553, Msg: "denied"}}, false},
+		{"connection error", &Error{Op: "retr", Path: "a", Err: io.ErrUnexpectedEOF}, false},
+	}
+	for _, test := range tests {
+		if got := errors.Is(test.err, ErrNotFound); got != test.want {
+			t.Errorf("%s: errors.Is(%v, ErrNotFound) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+func TestErrorUnwrap(t *testing.T) {
+	reply := &textproto.Error{Code: 530, Msg: "Login incorrect"}
+	err := error(&Error{Op: "login", Path: "ftp://user@example.com:21", Err: reply})
+	var tp *textproto.Error
+	if !errors.As(err, &tp) || tp != reply {
+		t.Errorf("errors.As(%v) didn't find the reply", err)
+	}
+	if !errors.Is(&Error{Op: "retr", Path: "a", Err: io.ErrUnexpectedEOF}, io.ErrUnexpectedEOF) {
+		t.Errorf("errors.Is() didn't find the wrapped error")
+	}
+	if got, want := err.Error(), "ftp login ftp://user@example.com:21: "+reply.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestDirPrefixes(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want []string
+	}{
+		{"", []string{}},
+		{".", []string{}},
+		{"/", []string{}},
+		{"a", []string{"a"}},
+		{"public_html/releases/2022.1", []string{"public_html", "public_html/releases", "public_html/releases/2022.1"}},
+		{"/srv/ftp", []string{"/srv", "/srv/ftp"}},
+		{"./a//b/", []string{"a", "a/b"}},
+	}
+	for _, test := range tests {
+		if got := dirPrefixes(test.dir); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("dirPrefixes(%q) = %q, want %q", test.dir, got, test.want)
+		}
+	}
+}
+
+// A minimal FTP server that keeps the stored files in memory. The user's home directory is /home.
+type fakeServer struct {
+	listener net.Listener
+
+	mutex sync.Mutex
+	dirs  map[string]bool
+	files map[string][]byte
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: l, dirs: map[string]bool{"/": true, "/home": true}, files: make(map[string][]byte)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return s
+}
+
+func (s *fakeServer) profile() Profile {
+	return Profile{Host: s.listener.Addr().String(), User: "user", Password: "password"}
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	var data net.Listener
+	reply("220 Ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg := strings.TrimSpace(line), ""
+		if i := strings.IndexByte(cmd, ' '); i >= 0 {
+			cmd, arg = cmd[:i], cmd[i+1:]
+		}
+		s.mutex.Lock()
+		exists, dirExists := s.dirs[arg], s.dirs[path.Dir(arg)]
+		s.mutex.Unlock()
+		switch cmd {
+		case "USER":
+			reply("331 Password required")
+		case "PASS":
+			reply("230 Logged in")
+		case "TYPE":
+			reply("200 OK")
+		case "PWD":
+			reply(`257 "/home"`)
+		case "CWD":
+			if exists {
+				reply("250 OK")
+			} else {
+				reply("550 No such directory")
+			}
+		case "MKD":
+			s.mutex.Lock()
+			s.dirs[arg] = true
+			s.mutex.Unlock()
+			reply(`257 "%s"`, arg)
+		case "EPSV":
+			data, err = net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				return
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "STOR":
+			if !dirExists {
+				reply("550 No such directory")
+				continue
+			}
+			reply("150 Ok to send data")
+			dc, err := data.Accept()
+			data.Close()
+			if err != nil {
+				return
+			}
+			contents, _ := ioutil.ReadAll(dc)
+			dc.Close()
+			s.mutex.Lock()
+			s.files[arg] = contents
+			s.mutex.Unlock()
+			reply("226 Transfer complete")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+func TestUploadFile(t *testing.T) {
+	s := newFakeServer(t)
+	c := New(s.profile())
+	defer c.Close()
+
+	dir := filepath.Join(t.TempDir(), "build", "symbol-store-windows")
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "foo.pdb")
+	err = ioutil.WriteFile(src, []byte("symbols"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.UploadFile(src, "symbols/foo.pdb/0123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if got := string(s.files["/home/symbols/foo.pdb/0123/foo.pdb"]); got != "symbols" {
+		t.Errorf("UploadFile() stored %q, want the file in /home/symbols/foo.pdb/0123, stored files: %v", got, s.files)
+	}
+}
@@ -0,0 +1,56 @@
+// Package libindex is the lib index that upload-lib.go maintains in the lib directory of the
+// website and that release.go fetches and mirrors libs with.
+package libindex
+
+import (
+	"regexp"
+	"sort"
+)
+
+// Name of the lib index in the lib directory.
+const LIB_INDEX = "index.json"
+
+// Matches the name of a lib: <lib>-<version>-<platform>. Lib files are named <name>.zip.
+var NameRe = regexp.MustCompile(`^(.+?)-(\d[^-]*)-([A-Za-z0-9_]+)$`)
+
+// An uploaded lib.
+type Entry struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	File     string `json:"file"`
+	Size     int64  `json:"size"`
+	Sha256   string `json:"sha256"`
+	Uploaded string `json:"uploaded"`
+	Uploader string `json:"uploader"`
+}
+
+// The lib index, sorted by file name.
+type Index struct {
+	Libs []Entry `json:"libs"`
+}
+
+// Returns an empty index.
+func New() *Index {
+	return &Index{Libs: []Entry{}}
+}
+
+// Returns the entry for the lib file, or nil if it isn't in the index.
+func (index *Index) Find(file string) *Entry {
+	for i := range index.Libs {
+		if index.Libs[i].File == file {
+			return &index.Libs[i]
+		}
+	}
+	return nil
+}
+
+// Adds the entry to the index, replacing any existing entry for the same file.
+func (index *Index) Add(e Entry) {
+	if existing := index.Find(e.File); existing != nil {
+		*existing = e
+		return
+	}
+	index.Libs = append(index.Libs, e)
+	sort.Slice(index.Libs, func(i, j int) bool { return index.Libs[i].File < index.Libs[j].File })
+}
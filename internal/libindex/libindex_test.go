@@ -0,0 +1,84 @@
+package libindex
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func files(index *Index) []string {
+	names := []string{}
+	for _, e := range index.Libs {
+		names = append(names, e.File)
+	}
+	return names
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		add   []Entry
+		files string
+		hash  string
+	}{
+		{"sorted", []Entry{{File: "b.zip"}, {File: "c.zip"}, {File: "a.zip"}}, `["a.zip","b.zip","c.zip"]`, ""},
+		{"replaced", []Entry{{File: "a.zip", Sha256: "1"}, {File: "b.zip"}, {File: "a.zip", Sha256: "2"}}, `["a.zip","b.zip"]`, "2"},
+	}
+	for _, test := range tests {
+		index := New()
+		for _, e := range test.add {
+			index.Add(e)
+		}
+		got, _ := json.Marshal(files(index))
+		if string(got) != test.files {
+			t.Errorf("%s: files are %s, want %s", test.name, got, test.files)
+		}
+		if e := index.Find("a.zip"); e == nil || e.Sha256 != test.hash {
+			t.Errorf("%s: Find(a.zip) = %+v, want the hash %q", test.name, e, test.hash)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	index := New()
+	if e := index.Find("a.zip"); e != nil {
+		t.Errorf("Find() in an empty index = %+v", e)
+	}
+	index.Add(Entry{File: "a.zip", Size: 1})
+	index.Find("a.zip").Size = 2
+	if index.Libs[0].Size != 2 {
+		t.Errorf("Find() doesn't return the entry in the index")
+	}
+}
+
+func TestNewMarshalsEmptyList(t *testing.T) {
+	data, err := json.Marshal(New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"libs":[]}` {
+		t.Errorf("New() marshals as %s", data)
+	}
+}
+
+func TestNameRe(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"bgfx-2021.1-windows", []string{"bgfx", "2021.1", "windows"}},
+		{"dxc-shader-compiler-1.6.2104-linux", []string{"dxc-shader-compiler", "1.6.2104", "linux"}},
+		{"openxr-1.0.12-x86_64", []string{"openxr", "1.0.12", "x86_64"}},
+		{"bgfx-windows", nil},
+		{"bgfx-latest-windows", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		if m := NameRe.FindStringSubmatch(test.name); m != nil {
+			got = m[1:]
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("NameRe.FindStringSubmatch(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
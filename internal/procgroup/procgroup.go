@@ -0,0 +1,4 @@
+// Package procgroup kills commands together with the processes they have started. On Unix, the
+// commands are started in their own process group and the whole group is killed. On Windows,
+// the process tree is killed with taskkill.
+package procgroup
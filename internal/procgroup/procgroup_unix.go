@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package procgroup
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Makes the command start in a new process group. Must be called before the command is started.
+//
+// Processes in the group don't get the terminal's signals, so Ctrl-C has to be forwarded with
+// Kill(), and they are stopped if they read from the terminal.
+func Prepare(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Kills the process and all processes in its process group.
+func Kill(p *os.Process) error {
+	err := syscall.Kill(-p.Pid, syscall.SIGKILL)
+	if err != nil {
+		return p.Kill()
+	}
+	return nil
+}
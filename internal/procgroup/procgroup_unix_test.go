@@ -0,0 +1,46 @@
+//go:build !windows
+// +build !windows
+
+package procgroup
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestKillKillsTheGroup(t *testing.T) {
+	// The background sleep keeps stdout open until it is killed.
+	cmd := exec.Command("sh", "-c", "sleep 60 & echo started; wait")
+	Prepare(cmd)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	_, err = out.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Kill(cmd.Process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan bool)
+	go func() {
+		ioutil.ReadAll(out)
+		closed <- true
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the background process is still running")
+	}
+	cmd.Wait()
+}
@@ -0,0 +1,20 @@
+package procgroup
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Does nothing on Windows, where the process tree is found by Kill().
+func Prepare(cmd *exec.Cmd) {
+}
+
+// Kills the process and the processes it has started.
+func Kill(p *os.Process) error {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run()
+	if err != nil {
+		return p.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+// Fetches, verifies and mirrors the libs that upload-lib.go uploads to the website:
+//
+//     go run lib.go [-source <store>] fetch <lib> <version> [platform]
+//     go run lib.go [-source <store>] verify
+//     go run lib.go [-source <store>] mirror <destination store>
+//
+// A store is `ftp:<dir>` on the server given by -profile (see ftpclient.ParseProfile()),
+// `dir:<local dir>` or the `http(s)://` URL of a file API such as the one served by
+// `go run release.go archive-server`. The default source is the lib directory of the website,
+// FTP stores need -password. Fetched libs are cached in the directory given by -cache.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"ourmachinery.com/niklas-snippets/internal/ftpclient"
+	"ourmachinery.com/niklas-snippets/internal/libindex"
+)
+
+// A place where libs are stored, with the lib index next to them.
+type store interface {
+	// Returns the contents of the file. If the file doesn't exist, the error satisfies
+	// isNotFound().
+	Read(file string) ([]byte, error)
+
+	// Replaces the contents of the file.
+	Write(file string, data []byte) error
+
+	// Returns the size of every file in the store.
+	List() (map[string]int64, error)
+
+	Close()
+}
+
+// Returns true if the error from a store means that the file doesn't exist, as opposed to the
+// store failing.
+func isNotFound(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, ftpclient.ErrNotFound)
+}
+
+// A directory on an FTP server.
+type ftpStore struct {
+	dir    string
+	client *ftpclient.Client
+}
+
+func (s *ftpStore) Read(file string) ([]byte, error) {
+	return s.client.ReadFile(path.Join(s.dir, file))
+}
+
+// Writes the file under a temporary name and renames it, so that the store never has a partial
+// file.
+func (s *ftpStore) Write(file string, data []byte) error {
+	tmp := path.Join(s.dir, file+".tmp")
+	err := s.client.Stor(tmp, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return s.client.Rename(tmp, path.Join(s.dir, file))
+}
+
+func (s *ftpStore) List() (map[string]int64, error) {
+	return s.client.List(s.dir)
+}
+
+func (s *ftpStore) Close() {
+	s.client.Close()
+}
+
+// A local directory, such as a mounted network share.
+type dirStore struct {
+	dir string
+}
+
+func (s *dirStore) Read(file string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, file))
+}
+
+// Writes the file under a temporary name and renames it, so that the store never has a partial
+// file.
+func (s *dirStore) Write(file string, data []byte) error {
+	err := os.MkdirAll(s.dir, 0777)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, file+".tmp")
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, file))
+}
+
+func (s *dirStore) List() (map[string]int64, error) {
+	files := make(map[string]int64)
+	entries, err := ioutil.ReadDir(s.dir)
+	for _, e := range entries {
+		if !e.IsDir() {
+			files[e.Name()] = e.Size()
+		}
+	}
+	return files, err
+}
+
+func (s *dirStore) Close() {
+}
+
+// An HTTP file API: files are read with GET and written with PUT, and `GET /?list` returns the
+// sizes of the files as JSON.
+type httpStore struct {
+	url string
+}
+
+func (s *httpStore) do(method, file string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(s.url, "/")+"/"+file, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s %s: %w", method, file, os.ErrNotExist)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.New(method + " " + file + ": " + resp.Status)
+	}
+	return data, nil
+}
+
+func (s *httpStore) Read(file string) ([]byte, error) {
+	return s.do(http.MethodGet, file, nil)
+}
+
+func (s *httpStore) Write(file string, data []byte) error {
+	_, err := s.do(http.MethodPut, file, bytes.NewReader(data))
+	return err
+}
+
+func (s *httpStore) List() (map[string]int64, error) {
+	files := make(map[string]int64)
+	data, err := s.do(http.MethodGet, "?list", nil)
+	if err != nil {
+		return files, err
+	}
+	err = json.Unmarshal(data, &files)
+	return files, err
+}
+
+func (s *httpStore) Close() {
+}
+
+// Opens the store given by a specification of the form `ftp:<dir>`, `dir:<local dir>` or
+// `http(s)://<file API url>`.
+func openStore(spec, profile, password string) store {
+	switch {
+	case strings.HasPrefix(spec, "ftp:"):
+		if password == "" {
+			log.Fatal("No password specified for " + spec)
+		}
+		p, err := ftpclient.ParseProfile(profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p.Password = password
+		return &ftpStore{dir: strings.TrimPrefix(spec, "ftp:"), client: ftpclient.New(p)}
+	case strings.HasPrefix(spec, "dir:"):
+		return &dirStore{dir: strings.TrimPrefix(spec, "dir:")}
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return &httpStore{url: spec}
+	}
+	log.Fatal("Unknown store: " + spec)
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readLibIndex(s store) *libindex.Index {
+	index := libindex.New()
+	data, err := s.Read(libindex.LIB_INDEX)
+	if err != nil {
+		log.Fatal("Can't read the lib index: " + err.Error())
+	}
+	err = json.Unmarshal(data, index)
+	if err != nil {
+		log.Fatal("Can't parse " + libindex.LIB_INDEX + ": " + err.Error())
+	}
+	return index
+}
+
+// Returns the cached copy of the lib, fetching it from the store if it isn't cached or doesn't
+// match the index.
+func fetchLib(s store, e libindex.Entry, cacheDir string) string {
+	file := filepath.Join(cacheDir, e.File)
+	if data, err := ioutil.ReadFile(file); err == nil && sha256Hex(data) == e.Sha256 {
+		return file
+	}
+	data, err := s.Read(e.File)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sha256Hex(data) != e.Sha256 {
+		log.Fatal(e.File + " doesn't match the hash in the lib index")
+	}
+	err = (&dirStore{dir: cacheDir}).Write(e.File, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("fetched " + e.File)
+	return file
+}
+
+// Checks the cached libs against the index. Returns the problems found.
+func verifyLibs(index *libindex.Index, cacheDir string) []string {
+	problems := []string{}
+	files, err := filepath.Glob(filepath.Join(cacheDir, "*.zip"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range files {
+		e := index.Find(filepath.Base(file))
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if e == nil {
+			problems = append(problems, filepath.Base(file)+" is not in the lib index")
+		} else if sha256Hex(data) != e.Sha256 {
+			problems = append(problems, filepath.Base(file)+" doesn't match the hash in the lib index")
+		}
+	}
+	return problems
+}
+
+// Copies the libs that are missing or differ in `dst` through the cache, and then the index.
+func mirrorLibs(src, dst store, index *libindex.Index, cacheDir string) {
+	existing, err := dst.List()
+	if isNotFound(err) {
+		existing = make(map[string]int64)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	dstIndex := libindex.New()
+	data, err := dst.Read(libindex.LIB_INDEX)
+	if err == nil {
+		err = json.Unmarshal(data, dstIndex)
+		if err != nil {
+			log.Println("WARNING: Can't parse the mirrored lib index, mirroring all libs: " + err.Error())
+			dstIndex = libindex.New()
+		}
+	} else if !isNotFound(err) {
+		log.Fatal(err)
+	}
+	copied := 0
+	for _, e := range index.Libs {
+		if d := dstIndex.Find(e.File); d != nil && d.Sha256 == e.Sha256 && existing[e.File] == e.Size {
+			continue
+		}
+		data, err := ioutil.ReadFile(fetchLib(src, e, cacheDir))
+		if err == nil {
+			err = dst.Write(e.File, data)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("mirrored " + e.File)
+		copied++
+	}
+	// The index is written last so that it never lists libs that are missing from the mirror.
+	data, err = json.MarshalIndent(index, "", "    ")
+	if err == nil {
+		err = dst.Write(libindex.LIB_INDEX, data)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Mirrored %d libs, %d were up to date.\n", copied, len(index.Libs)-copied)
+}
+
+func main() {
+	var source, profile, password, cacheDir string
+
+	flag.StringVar(&source, "source", "ftp:public_html/lib", "store to get the libs from")
+	flag.StringVar(&profile, "profile", ftpclient.DefaultProfile, "ftp server and user of ftp stores")
+	flag.StringVar(&password, "password", "", "ftp password")
+	flag.StringVar(&cacheDir, "cache", "", "directory to cache fetched libs in")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: go run lib.go [flags] fetch <lib> <version> [platform]")
+		fmt.Fprintln(flag.CommandLine.Output(), "       go run lib.go [flags] verify")
+		fmt.Fprintln(flag.CommandLine.Output(), "       go run lib.go [flags] mirror <destination store>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if cacheDir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheDir = filepath.Join(cache, "the-machinery-libs")
+	}
+	err := os.MkdirAll(cacheDir, 0777)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := flag.Args()
+	switch {
+	case (len(args) == 3 || len(args) == 4) && args[0] == "fetch":
+		platform := runtime.GOOS
+		if len(args) == 4 {
+			platform = args[3]
+		}
+		src := openStore(source, profile, password)
+		defer src.Close()
+		file := args[1] + "-" + args[2] + "-" + platform + ".zip"
+		e := readLibIndex(src).Find(file)
+		if e == nil {
+			log.Fatal(file + " is not in the lib index")
+		}
+		fmt.Println(fetchLib(src, *e, cacheDir))
+	case len(args) == 1 && args[0] == "verify":
+		src := openStore(source, profile, password)
+		problems := verifyLibs(readLibIndex(src), cacheDir)
+		src.Close()
+		for _, p := range problems {
+			fmt.Println("    " + p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("The libs in " + cacheDir + " match the lib index.")
+	case len(args) == 2 && args[0] == "mirror":
+		src := openStore(source, profile, password)
+		defer src.Close()
+		dst := openStore(args[1], profile, password)
+		defer dst.Close()
+		mirrorLibs(src, dst, readLibIndex(src), cacheDir)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
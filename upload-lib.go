@@ -1,51 +1,278 @@
+// Uploads lib zips to the website and records them in the lib index (lib/index.json):
+//
+//     go run upload-lib.go -password <password> -lib <lib>-<version>-<platform>.zip [-force]
+//
+// -profile connects to another server than the website, see ftpclient.ParseProfile().
+//
+// -lib can be repeated or be a directory, in which case all zips in it are uploaded. Libs that
+// are already on the server with the same contents are skipped. Other existing lib versions are
+// only overwritten with -force.
+
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
+	"os/user"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/jlaffaye/ftp"
+	"ourmachinery.com/niklas-snippets/internal/ftpclient"
+	"ourmachinery.com/niklas-snippets/internal/libindex"
 )
 
-func main() {
-	var password string
-	var lib string
+// Directory of the libs on the server.
+const LIB_DIR = "public_html/lib"
 
-	flag.StringVar(&password, "password", "", "ftp password")
-	flag.StringVar(&lib, "lib", "", "lib zip file")
-	flag.Parse()
+func fileSha256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	if password == "" {
-		log.Fatal("No password specified")
+func uploader() string {
+	name, _ := exec.Command("git", "config", "user.name").Output()
+	email, _ := exec.Command("git", "config", "user.email").Output()
+	s := strings.TrimSpace(string(name))
+	if usr, err := user.Current(); err == nil && s == "" {
+		s = usr.Username
+	}
+	if e := strings.TrimSpace(string(email)); e != "" {
+		s += " <" + e + ">"
 	}
+	return s
+}
 
-	if lib == "" {
-		log.Fatal("No library specified")
+// Reads the lib index from the server. Returns an empty index if there is none.
+func readLibIndex(c *ftpclient.Client) *libindex.Index {
+	index := libindex.New()
+	data, err := c.ReadFile(path.Join(LIB_DIR, libindex.LIB_INDEX))
+	if errors.Is(err, ftpclient.ErrNotFound) {
+		return index
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	err = json.Unmarshal(data, index)
+	if err != nil {
+		log.Fatal("Can't parse " + libindex.LIB_INDEX + ": " + err.Error())
 	}
+	return index
+}
 
-	c, err := ftp.Dial("92.205.9.87:21")
+// Writes the lib index under a temporary name and renames it, so that the server never has a
+// partial index. Servers that can't rename over an existing file are without an index between
+// deleting the old one and renaming the new one.
+func writeLibIndex(c *ftpclient.Client, index *libindex.Index) {
+	data, err := json.MarshalIndent(index, "", "    ")
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	err = c.Login("ourmachinery", password)
+	file := path.Join(LIB_DIR, libindex.LIB_INDEX)
+	err = c.Stor(file+".tmp", bytes.NewReader(data))
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	err = c.ChangeDir("public_html/lib")
+	err = c.Rename(file+".tmp", file)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
+
+// Lib files given with -lib, which can be repeated.
+type libFlags []string
+
+func (l *libFlags) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *libFlags) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Returns the zips to upload, expanding directories.
+func libFiles(libs []string) []string {
+	files := []string{}
+	for _, lib := range libs {
+		if stat, err := os.Stat(lib); err == nil && stat.IsDir() {
+			zips, err := filepath.Glob(filepath.Join(lib, "*.zip"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			files = append(files, zips...)
+		} else {
+			files = append(files, lib)
+		}
+	}
+	return files
+}
+
+// Returns the SHA-256 of the file on the server.
+func remoteSha256(c *ftpclient.Client, file string) (string, error) {
+	r, err := c.Retr(file)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Result of uploading a lib.
+const (
+	UPLOADED = "uploaded"
+	SKIPPED  = "skipped"
+	REJECTED = "rejected"
+)
+
+// Uploads the lib unless the server already has identical contents. Returns the result and the
+// reason for it. Libs that fail to upload are rejected, so that the index still gets the libs that
+// were uploaded before them. The lib is uploaded under a temporary name and renamed, so that the
+// server never has a partial lib under its real name.
+func uploadLib(c *ftpclient.Client, index *libindex.Index, lib string, force bool) (string, string) {
+	libBase := filepath.Base(lib)
+	m := libindex.NameRe.FindStringSubmatch(strings.TrimSuffix(libBase, ".zip"))
+	if m == nil || !strings.HasSuffix(libBase, ".zip") {
+		return REJECTED, "not named <lib>-<version>-<platform>.zip"
+	}
+	stat, err := os.Stat(lib)
+	if err != nil {
+		return REJECTED, err.Error()
+	}
+	hash, err := fileSha256(lib)
+	if err != nil {
+		return REJECTED, err.Error()
+	}
+
+	existing := index.Find(libBase)
+	remoteFile := path.Join(LIB_DIR, libBase)
+	remoteSize, sizeErr := c.FileSize(remoteFile)
+	if sizeErr != nil && !errors.Is(sizeErr, ftpclient.ErrNotFound) {
+		return REJECTED, sizeErr.Error()
+	}
+	if existing != nil && existing.Sha256 == hash && sizeErr == nil && remoteSize == stat.Size() {
+		return SKIPPED, "identical to the uploaded lib"
+	}
+	if existing == nil && sizeErr == nil && remoteSize == stat.Size() {
+		// Uploaded before there was an index.
+		if remoteHash, err := remoteSha256(c, remoteFile); err == nil && remoteHash == hash {
+			index.Add(libindex.Entry{Name: m[1], Version: m[2], Platform: m[3], File: libBase, Size: stat.Size(), Sha256: hash, Uploaded: time.Now().UTC().Format(time.RFC3339), Uploader: uploader()})
+			return SKIPPED, "identical to the file on the server, added it to the index"
+		}
+	}
+	if (existing != nil || sizeErr == nil) && !force {
+		return REJECTED, "a different " + libBase + " already exists, use -force to overwrite it"
+	}
+	for _, e := range index.Libs {
+		if e.Sha256 == hash && e.File != libBase {
+			log.Println("WARNING: " + libBase + " has the same contents as " + e.File)
+		}
+	}
 
 	f, err := os.Open(lib)
+	if err != nil {
+		return REJECTED, err.Error()
+	}
+	err = c.Stor(remoteFile+".tmp", f)
+	f.Close()
+	if err == nil {
+		err = c.Rename(remoteFile+".tmp", remoteFile)
+	}
+	if err != nil {
+		c.Delete(remoteFile + ".tmp")
+		return REJECTED, err.Error()
+	}
+
+	index.Add(libindex.Entry{
+		Name:     m[1],
+		Version:  m[2],
+		Platform: m[3],
+		File:     libBase,
+		Size:     stat.Size(),
+		Sha256:   hash,
+		Uploaded: time.Now().UTC().Format(time.RFC3339),
+		Uploader: uploader(),
+	})
+	return UPLOADED, ""
+}
+
+func main() {
+	var password string
+	var libs libFlags
+	var force bool
+	var profile string
+
+	flag.StringVar(&password, "password", "", "ftp password")
+	flag.Var(&libs, "lib", "lib zip file or directory of lib zips, can be repeated")
+	flag.BoolVar(&force, "force", false, "overwrite an existing lib version")
+	flag.StringVar(&profile, "profile", ftpclient.DefaultProfile, "ftp server and user")
+	flag.Parse()
+
+	if password == "" {
+		log.Fatal("No password specified")
+	}
+
+	if len(libs) == 0 {
+		log.Fatal("No library specified")
+	}
+	files := libFiles(libs)
+
+	p, err := ftpclient.ParseProfile(profile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	libBase := path.Base(lib)
-	err = c.Stor(libBase, f)
+	p.Password = password
+	c := ftpclient.New(p)
 
-	c.Quit()
+	index := readLibIndex(c)
+	before, _ := json.Marshal(index)
+	results := make(map[string][]string)
+	for _, lib := range files {
+		result, reason := uploadLib(c, index, lib, force)
+		line := filepath.Base(lib)
+		if reason != "" {
+			line += ": " + reason
+		}
+		log.Println(result + " " + line)
+		results[result] = append(results[result], line)
+	}
+	if after, _ := json.Marshal(index); !bytes.Equal(before, after) {
+		writeLibIndex(c, index)
+	}
+	c.Close()
+
+	if len(files) > 1 {
+		for _, result := range []string{UPLOADED, SKIPPED, REJECTED} {
+			fmt.Printf("%s (%d):\n", result, len(results[result]))
+			for _, line := range results[result] {
+				fmt.Println("    " + line)
+			}
+		}
+	}
+	if len(results[REJECTED]) > 0 {
+		os.Exit(1)
+	}
 }
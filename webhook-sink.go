@@ -0,0 +1,38 @@
+// Local stand-in for the announcement webhooks, used to test the release announcement without
+// posting it anywhere:
+//
+//     go run webhook-sink.go [-addr localhost:8091]
+//     go run release.go announce -webhooks text:http://localhost:8091/text,content:http://localhost:8091/content,json:http://localhost:8091/json <version>
+//
+// Prints each request it receives and rejects requests that aren't JSON posts.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8091", "Address to listen on")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Println(r.Method + " " + r.URL.Path + ": " + string(body))
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || !json.Valid(body) {
+			fmt.Println("    rejected, expected a JSON post")
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	})
+	fmt.Println("Listening on http://" + *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}